@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// caldavBackend implements caldav.Backend for a single calendar, resolved
+// from the request path before the Handler is invoked. go-webdav/caldav's
+// Backend models one calendar per backend instance (Calendar and
+// ListCalendarObjects take no path), so serveCalDAV builds a fresh backend
+// per request rather than trying to recover the path from inside it.
+type caldavBackend struct {
+	s          *Service
+	year       int32
+	calendarID int64
+}
+
+func (b *caldavBackend) path() string {
+	return fmt.Sprintf("/dav/calendars/%d/%d/", b.year, b.calendarID)
+}
+
+// Calendar returns the collection metadata for this backend's calendar.
+func (b *caldavBackend) Calendar(ctx context.Context) (*caldav.Calendar, error) {
+	var title string
+	row := b.s.db.QueryRow("select title from calendars where id = ? and year = ?", b.calendarID, b.year)
+	if err := row.Scan(&title); err != nil {
+		return nil, err
+	}
+
+	return &caldav.Calendar{
+		Path:                  b.path(),
+		Name:                  title,
+		SupportedComponentSet: []string{"VEVENT"},
+	}, nil
+}
+
+// GetCalendarObject returns a single entry as a CalDAV object.
+func (b *caldavBackend) GetCalendarObject(ctx context.Context, path string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	entries, err := b.s.findCalDAVEntries(b.calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if calDAVEntryPath(b.year, b.calendarID, e.ID) == path {
+			return entryToCalendarObject(path, b.year, e), nil
+		}
+	}
+
+	return nil, fmt.Errorf("caldav: object not found: %s", path)
+}
+
+// ListCalendarObjects lists every entry in the calendar as CalDAV objects.
+func (b *caldavBackend) ListCalendarObjects(ctx context.Context, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	entries, err := b.s.findCalDAVEntries(b.calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]caldav.CalendarObject, 0, len(entries))
+	for _, e := range entries {
+		objects = append(objects, *entryToCalendarObject(calDAVEntryPath(b.year, b.calendarID, e.ID), b.year, e))
+	}
+
+	return objects, nil
+}
+
+// findCalDAVEntries lists every entry on calendarID, regardless of the
+// calendar's visibility: unlike the anonymous iCal feed, serveCalDAVCalendar
+// has already checked the authenticated caller may see calendarID before a
+// caldavBackend is ever built, so reusing findICalEntries' public-only
+// join here would silently empty out a subscription to the owner's own
+// private or group calendar.
+func (s *Service) findCalDAVEntries(calendarID int64) ([]*icalEntry, error) {
+	rows, err := s.db.Query(`
+		select
+			e.id,
+			e.day,
+			e.title,
+			e.comment,
+			e.url,
+			u.name
+		from entries as e
+		inner join users as u on u.id = e.user_id
+		where e.calendar_id = ?
+		order by e.day
+	`, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*icalEntry{}
+	for rows.Next() {
+		var e icalEntry
+		if err := rows.Scan(&e.ID, &e.Day, &e.Title, &e.Comment, &e.URL, &e.OwnerName); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, nil
+}
+
+// QueryCalendarObjects filters entries by the CompFilter time range, as the
+// alps caldav plugin does.
+func (b *caldavBackend) QueryCalendarObjects(ctx context.Context, query *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	objects, err := b.ListCalendarObjects(ctx, &query.CompRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := objects[:0]
+	for _, obj := range objects {
+		event, err := obj.Data.Children[0].Props.Get(ical.PropDateTimeStart).DateTime(time.UTC)
+		if err != nil {
+			continue
+		}
+		if compFilterMatches(query.CompFilter, event) {
+			filtered = append(filtered, obj)
+		}
+	}
+
+	return filtered, nil
+}
+
+// PutCalendarObject and DeleteCalendarObject exist only to satisfy
+// caldav.Backend: this frontend is read-only, mirroring the rest of the
+// iCal export surface.
+func (b *caldavBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.CalendarObject, error) {
+	return nil, fmt.Errorf("caldav: this calendar is read-only")
+}
+
+func (b *caldavBackend) DeleteCalendarObject(ctx context.Context, path string) error {
+	return fmt.Errorf("caldav: this calendar is read-only")
+}
+
+func compFilterMatches(filter caldav.CompFilter, t time.Time) bool {
+	if !filter.Start.IsZero() && t.Before(filter.Start) {
+		return false
+	}
+	if !filter.End.IsZero() && !t.Before(filter.End) {
+		return false
+	}
+	for _, comp := range filter.Comps {
+		if comp.Name == ical.CompEvent && !compFilterMatches(comp, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func entryToCalendarObject(path string, year int32, e *icalEntry) *caldav.CalendarObject {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, "-//adventar//adventar//EN")
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Children = append(cal.Children, buildVEvent(fmt.Sprintf("calendar-%d", year), year, e))
+
+	return &caldav.CalendarObject{Path: path, Data: cal}
+}
+
+func calDAVEntryPath(year int32, calendarID, entryID int64) string {
+	return fmt.Sprintf("/dav/calendars/%d/%d/%d.ics", year, calendarID, entryID)
+}
+
+func parseCalDAVPath(path string) (year int32, calendarID int64, err error) {
+	var y, id int64
+	_, err = fmt.Sscanf(path, "/dav/calendars/%d/%d/", &y, &id)
+	return int32(y), id, err
+}
+
+// serveCalDAV starts an HTTP server exposing the CalDAV frontend, reusing
+// verifier.VerifyIDToken for HTTP Basic auth (the ID token goes in the
+// password field) so clients like Thunderbird and iOS can browse/subscribe.
+// Each request is routed to a fresh caldav.Handler scoped to the calendar
+// named in its path, after checking the caller may see it.
+func (s *Service) serveCalDAV(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dav/calendars/", s.serveCalDAVCalendar)
+
+	if err := http.ListenAndServe(addr, s.requireBasicAuth(mux)); err != nil {
+		log.Fatalf("failed to serve caldav: %v", err)
+	}
+}
+
+func (s *Service) serveCalDAVCalendar(w http.ResponseWriter, r *http.Request) {
+	year, calendarID, err := parseCalDAVPath(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	canRead, err := s.calendarVisibleTo(calendarID, s.currentCalDAVUser(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canRead {
+		http.NotFound(w, r)
+		return
+	}
+
+	handler := &caldav.Handler{Backend: &caldavBackend{s: s, year: year, calendarID: calendarID}}
+	handler.ServeHTTP(w, r)
+}
+
+// currentCalDAVUser resolves the caller from the HTTP Basic auth password
+// (an ID token), mirroring getCurrentUser's gRPC-metadata lookup. Returns
+// nil if there's no caller, which requireBasicAuth has already ruled out
+// for a non-public calendar by the time this runs.
+func (s *Service) currentCalDAVUser(r *http.Request) *user {
+	_, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	u, err := s.userFromToken(password)
+	if err != nil {
+		return nil
+	}
+
+	return u
+}
+
+func (s *Service) requireBasicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="adventar"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, err := s.userFromToken(password); err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="adventar"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	pb "github.com/adventar/adventar/grpc-server/adventar/v1"
+)
+
+// CreateGroup creates a group and makes the caller its first member.
+func (s *Service) CreateGroup(ctx context.Context, in *pb.CreateGroupRequest) (*pb.Group, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.db.Prepare("insert into groups(name) values(?)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	groupID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Exec("insert into group_members(group_id, user_id) values(?, ?)", groupID, currentUser.ID); err != nil {
+		return nil, err
+	}
+
+	return &pb.Group{Id: groupID, Name: in.GetName()}, nil
+}
+
+// JoinGroup adds the caller to a group.
+func (s *Service) JoinGroup(ctx context.Context, in *pb.JoinGroupRequest) (*empty.Empty, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.db.Prepare("insert into group_members(group_id, user_id) values(?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(in.GetGroupId(), currentUser.ID); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// LeaveGroup removes the caller from a group.
+func (s *Service) LeaveGroup(ctx context.Context, in *pb.LeaveGroupRequest) (*empty.Empty, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.db.Prepare("delete from group_members where group_id = ? and user_id = ?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(in.GetGroupId(), currentUser.ID); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// ListGroupCalendars lists the calendars belonging to a group. The caller
+// must be a member of the group.
+func (s *Service) ListGroupCalendars(ctx context.Context, in *pb.ListGroupCalendarsRequest) (*pb.ListGroupCalendarsResponse, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var isMember bool
+	row := s.db.QueryRow("select 1 from group_members where group_id = ? and user_id = ?", in.GetGroupId(), currentUser.ID)
+	if err := row.Scan(&isMember); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if !isMember {
+		return nil, fmt.Errorf("not a member of group %d", in.GetGroupId())
+	}
+
+	rows, err := s.db.Query(`
+		select
+			c.id,
+			c.title,
+			c.description,
+			c.year,
+			u.id,
+			u.name,
+			u.icon_url
+		from calendars as c
+		inner join users as u on u.id = c.user_id
+		where c.group_id = ?
+		order by c.id desc
+	`, in.GetGroupId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calendars []*pb.Calendar
+	for rows.Next() {
+		var calendar pb.Calendar
+		var user pb.User
+		err := rows.Scan(
+			&calendar.Id,
+			&calendar.Title,
+			&calendar.Description,
+			&calendar.Year,
+			&user.Id,
+			&user.Name,
+			&user.IconUrl,
+		)
+		if err != nil {
+			return nil, err
+		}
+		calendar.Owner = &user
+		calendars = append(calendars, &calendar)
+	}
+
+	if len(calendars) != 0 {
+		if err := s.bindEntryCount(calendars); err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.ListGroupCalendarsResponse{Calendars: calendars}, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// icalEntry is the minimal projection of an entry needed to build a VEVENT.
+type icalEntry struct {
+	ID        int64
+	Day       int32
+	Title     string
+	Comment   string
+	URL       string
+	OwnerName string
+}
+
+// icalHandler returns an http.Handler serving the iCalendar subscription
+// feeds for calendars and per-user entry lists.
+func (s *Service) icalHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ical/calendars/", s.serveICalCalendar)
+	mux.HandleFunc("/ical/users/", s.serveICalUserEntries)
+	return mux
+}
+
+// serveICal starts an HTTP server for the iCalendar feed endpoints.
+func (s *Service) serveICal(addr string) {
+	if err := http.ListenAndServe(addr, s.icalHandler()); err != nil {
+		log.Fatalf("failed to serve ical: %v", err)
+	}
+}
+
+func (s *Service) serveICalCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := parseICalID(r.URL.Path, "/ical/calendars/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var year int32
+	row := s.db.QueryRow("select year from calendars where id = ?", id)
+	if err := row.Scan(&year); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The feed endpoints have no concept of a signed-in caller, so only
+	// public calendars may be exposed here.
+	canRead, err := s.calendarVisibleTo(id, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canRead {
+		http.NotFound(w, r)
+		return
+	}
+
+	entries, err := s.findICalEntries("e.calendar_id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeICal(w, fmt.Sprintf("calendar-%d", id), year, entries)
+}
+
+func (s *Service) serveICalUserEntries(w http.ResponseWriter, r *http.Request) {
+	userID, year, err := parseICalUserID(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	entries, err := s.findICalEntries("e.user_id = ? and c.year = ?", userID, year)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeICal(w, fmt.Sprintf("user-%d-%d", userID, year), year, entries)
+}
+
+// findICalEntries applies condition on top of the entries/users/calendars
+// join used by both feed endpoints. The feeds have no authenticated caller,
+// so entries belonging to a non-public calendar are always excluded here,
+// not just at the single-calendar lookup in serveICalCalendar.
+func (s *Service) findICalEntries(condition string, args ...interface{}) ([]*icalEntry, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
+		select
+			e.id,
+			e.day,
+			e.title,
+			e.comment,
+			e.url,
+			u.name
+		from entries as e
+		inner join users as u on u.id = e.user_id
+		inner join calendars as c on c.id = e.calendar_id
+		where c.visibility = 'public' and %s
+		order by e.day
+	`, condition), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*icalEntry{}
+	for rows.Next() {
+		var e icalEntry
+		if err := rows.Scan(&e.ID, &e.Day, &e.Title, &e.Comment, &e.URL, &e.OwnerName); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, nil
+}
+
+func writeICal(w http.ResponseWriter, uidPrefix string, year int32, entries []*icalEntry) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, "-//adventar//adventar//EN")
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
+
+	for _, e := range entries {
+		cal.Children = append(cal.Children, buildVEvent(uidPrefix, year, e))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	enc := ical.NewEncoder(w)
+	if err := enc.Encode(cal); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func buildVEvent(uidPrefix string, year int32, e *icalEntry) *ical.Component {
+	event := ical.NewComponent(ical.CompEvent)
+	event.Props.SetText(ical.PropUID, fmt.Sprintf("%s-entry-%d@adventar.org", uidPrefix, e.ID))
+
+	dtstart := ical.NewProp(ical.PropDateTimeStart)
+	dtstart.Params.Set(ical.ParamValue, string(ical.ValueDate))
+	dtstart.SetDateTime(time.Date(int(year), time.December, int(e.Day), 0, 0, 0, 0, time.UTC))
+	event.Props.Set(dtstart)
+
+	summary := e.Title
+	if summary == "" {
+		summary = e.OwnerName
+	}
+	event.Props.SetText(ical.PropSummary, summary)
+	event.Props.SetText(ical.PropDescription, e.Comment)
+	if e.URL != "" {
+		event.Props.SetText(ical.PropURL, e.URL)
+	}
+
+	return event
+}
+
+func parseICalID(path, prefix string) (int64, error) {
+	name := path[len(prefix):]
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '.' {
+			name = name[:i]
+			break
+		}
+	}
+	return strconv.ParseInt(name, 10, 64)
+}
+
+func parseICalUserID(path string) (int64, int32, error) {
+	// path is /ical/users/{id}/{year}.ics
+	rest := path[len("/ical/users/"):]
+	slash := -1
+	for i, c := range rest {
+		if c == '/' {
+			slash = i
+			break
+		}
+	}
+	if slash < 0 {
+		return 0, 0, fmt.Errorf("invalid path: %s", path)
+	}
+
+	userID, err := strconv.ParseInt(rest[:slash], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	year, err := parseICalID(rest[slash:], "/")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return userID, int32(year), nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	pb "github.com/adventar/adventar/grpc-server/adventar/v1"
+)
+
+// canWriteCalendar reports whether userID may create/update/delete entries
+// and edit metadata on calendarID, i.e. they are the owner or a member
+// granted write access.
+func (s *Service) canWriteCalendar(calendarID, userID int64) (bool, error) {
+	var canWrite bool
+	row := s.db.QueryRow("select can_write from calendar_members where calendar_id = ? and user_id = ?", calendarID, userID)
+	err := row.Scan(&canWrite)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return canWrite, nil
+}
+
+// isCalendarOwner reports whether userID is the owner of calendarID.
+func (s *Service) isCalendarOwner(calendarID, userID int64) (bool, error) {
+	var isOwner bool
+	row := s.db.QueryRow("select is_owner from calendar_members where calendar_id = ? and user_id = ?", calendarID, userID)
+	err := row.Scan(&isOwner)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return isOwner, nil
+}
+
+// AddCalendarMember grants a user access to a calendar. Only the owner may
+// add members.
+func (s *Service) AddCalendarMember(ctx context.Context, in *pb.AddCalendarMemberRequest) (*pb.CalendarMember, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isOwner, err := s.isCalendarOwner(in.GetCalendarId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwner {
+		return nil, fmt.Errorf("not the owner of calendar %d", in.GetCalendarId())
+	}
+
+	stmt, err := s.db.Prepare("insert into calendar_members(calendar_id, user_id, can_write, is_owner) values(?, ?, ?, false)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(in.GetCalendarId(), in.GetUserId(), in.GetCanWrite()); err != nil {
+		return nil, err
+	}
+
+	return &pb.CalendarMember{CalendarId: in.GetCalendarId(), UserId: in.GetUserId(), CanWrite: in.GetCanWrite(), IsOwner: false}, nil
+}
+
+// RemoveCalendarMember revokes a member's access to a calendar. Only the
+// owner may remove members, and the owner cannot be removed this way.
+func (s *Service) RemoveCalendarMember(ctx context.Context, in *pb.RemoveCalendarMemberRequest) (*empty.Empty, error) {
+	currentUser, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isOwner, err := s.isCalendarOwner(in.GetCalendarId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwner {
+		return nil, fmt.Errorf("not the owner of calendar %d", in.GetCalendarId())
+	}
+
+	stmt, err := s.db.Prepare("delete from calendar_members where calendar_id = ? and user_id = ? and is_owner = false")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(in.GetCalendarId(), in.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// ListCalendarMembers lists the members of a calendar, visible to anyone
+// who may view the calendar itself (same rule as GetCalendar), since the
+// member list is calendar metadata, not a write-access-only detail.
+func (s *Service) ListCalendarMembers(ctx context.Context, in *pb.ListCalendarMembersRequest) (*pb.ListCalendarMembersResponse, error) {
+	currentUser := s.tryCurrentUser(ctx)
+	canRead, err := s.calendarVisibleTo(in.GetCalendarId(), currentUser)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead {
+		return nil, fmt.Errorf("calendar %d not found", in.GetCalendarId())
+	}
+
+	rows, err := s.db.Query(`
+		select
+			m.user_id,
+			m.can_write,
+			m.is_owner,
+			u.name,
+			u.icon_url
+		from calendar_members as m
+		inner join users as u on u.id = m.user_id
+		where m.calendar_id = ?
+		order by m.is_owner desc, m.user_id
+	`, in.GetCalendarId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*pb.CalendarMember{}
+	for rows.Next() {
+		var m pb.CalendarMember
+		var u pb.User
+		if err := rows.Scan(&m.UserId, &m.CanWrite, &m.IsOwner, &u.Name, &u.IconUrl); err != nil {
+			return nil, err
+		}
+		m.CalendarId = in.GetCalendarId()
+		u.Id = m.UserId
+		m.User = &u
+		members = append(members, &m)
+	}
+
+	return &pb.ListCalendarMembersResponse{Members: members}, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCanWriteCalendar(t *testing.T) {
+	cases := []struct {
+		name     string
+		setup    func(mock sqlmock.Sqlmock)
+		wantErr  bool
+		wantBool bool
+	}{
+		{
+			name: "write member",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("select can_write from calendar_members").
+					WithArgs(int64(1), int64(2)).
+					WillReturnRows(sqlmock.NewRows([]string{"can_write"}).AddRow(true))
+			},
+			wantBool: true,
+		},
+		{
+			name: "read-only member",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("select can_write from calendar_members").
+					WithArgs(int64(1), int64(2)).
+					WillReturnRows(sqlmock.NewRows([]string{"can_write"}).AddRow(false))
+			},
+			wantBool: false,
+		},
+		{
+			name: "not a member",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("select can_write from calendar_members").
+					WithArgs(int64(1), int64(2)).
+					WillReturnRows(sqlmock.NewRows([]string{"can_write"}))
+			},
+			wantBool: false,
+		},
+		{
+			name: "query error",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("select can_write from calendar_members").
+					WithArgs(int64(1), int64(2)).
+					WillReturnError(errors.New("boom"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+			c.setup(mock)
+
+			s := &Service{db: db}
+			got, err := s.canWriteCalendar(1, 2)
+			if c.wantErr != (err != nil) {
+				t.Fatalf("canWriteCalendar() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if got != c.wantBool {
+				t.Errorf("canWriteCalendar() = %v, want %v", got, c.wantBool)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsCalendarOwner(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("select is_owner from calendar_members").
+		WithArgs(int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"is_owner"}).AddRow(true))
+
+	s := &Service{db: db}
+	isOwner, err := s.isCalendarOwner(1, 2)
+	if err != nil {
+		t.Fatalf("isCalendarOwner() error = %v", err)
+	}
+	if !isOwner {
+		t.Errorf("isCalendarOwner() = false, want true")
+	}
+}
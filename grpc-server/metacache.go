@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// cachedMeta is the OGP/Twitter Card metadata kept per URL.
+type cachedMeta struct {
+	Title     string
+	ImageURL  string
+	FetchedAt time.Time
+	ETag      string
+}
+
+// MetaCache stores the metadata UpdateEntry used to fetch synchronously on
+// every write. Get returns (nil, nil) on a cache miss.
+type MetaCache interface {
+	Get(url string) (*cachedMeta, error)
+	Put(url string, meta *cachedMeta) error
+}
+
+// dbMetaCache is a MetaCache backed by a `meta_cache` table, keyed by URL.
+type dbMetaCache struct {
+	db *sql.DB
+}
+
+func newDBMetaCache(db *sql.DB) *dbMetaCache {
+	return &dbMetaCache{db: db}
+}
+
+func (c *dbMetaCache) Get(rawURL string) (*cachedMeta, error) {
+	var m cachedMeta
+	row := c.db.QueryRow("select title, image_url, fetched_at, etag from meta_cache where url = ?", rawURL)
+	err := row.Scan(&m.Title, &m.ImageURL, &m.FetchedAt, &m.ETag)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (c *dbMetaCache) Put(rawURL string, m *cachedMeta) error {
+	_, err := c.db.Exec(`
+		insert into meta_cache(url, title, image_url, fetched_at, etag)
+		values(?, ?, ?, ?, ?)
+		on duplicate key update title = values(title), image_url = values(image_url), fetched_at = values(fetched_at), etag = values(etag)
+	`, rawURL, m.Title, m.ImageURL, m.FetchedAt, m.ETag)
+	return err
+}
+
+// perHostInterval rate-limits how often the queue will fetch any single
+// host, so one linked site can't be hammered by a burst of UpdateEntry calls.
+const perHostInterval = 2 * time.Second
+
+// metaFetchQueue fetches OGP/Twitter Card metadata off the UpdateEntry
+// request path: jobs are enqueued by URL and processed one at a time by a
+// background goroutine, with per-host rate limiting and SSRF guards applied
+// before any request is made.
+type metaFetchQueue struct {
+	fetcher metaFetcher
+	cache   MetaCache
+	jobs    chan string
+
+	mu        sync.Mutex
+	lastFetch map[string]time.Time
+}
+
+func newMetaFetchQueue(fetcher metaFetcher, cache MetaCache) *metaFetchQueue {
+	q := &metaFetchQueue{
+		fetcher:   fetcher,
+		cache:     cache,
+		jobs:      make(chan string, 256),
+		lastFetch: map[string]time.Time{},
+	}
+	go q.run()
+	return q
+}
+
+// Enqueue schedules a refresh of url's metadata. It never blocks the
+// caller: if the queue is full, the job is dropped and will be retried on
+// the next UpdateEntry cache miss.
+func (q *metaFetchQueue) Enqueue(rawURL string) {
+	select {
+	case q.jobs <- rawURL:
+	default:
+		log.Printf("meta fetch queue full, dropping %s", rawURL)
+	}
+}
+
+func (q *metaFetchQueue) run() {
+	for rawURL := range q.jobs {
+		q.fetchAndCache(rawURL)
+	}
+}
+
+func (q *metaFetchQueue) fetchAndCache(rawURL string) {
+	if err := rejectPrivateURL(rawURL); err != nil {
+		log.Printf("refusing to fetch %s: %v", rawURL, err)
+		return
+	}
+
+	q.waitForHostSlot(rawURL)
+
+	m, err := q.fetcher.Fetch(guardedHTTPClient(), rawURL)
+	if err != nil {
+		log.Printf("meta fetch failed for %s: %v", rawURL, err)
+		return
+	}
+
+	cached := &cachedMeta{Title: m.Title, ImageURL: m.ImageURL, FetchedAt: time.Now()}
+	if err := q.cache.Put(rawURL, cached); err != nil {
+		log.Printf("meta cache put failed for %s: %v", rawURL, err)
+	}
+}
+
+func (q *metaFetchQueue) waitForHostSlot(rawURL string) {
+	host := hostOf(rawURL)
+
+	q.mu.Lock()
+	wait := perHostInterval - time.Since(q.lastFetch[host])
+	if wait < 0 {
+		wait = 0
+	}
+	q.lastFetch[host] = time.Now().Add(wait)
+	q.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// rejectPrivateURL guards against SSRF: it refuses to fetch anything that
+// isn't plain http(s), and anything whose host resolves to a private,
+// loopback or link-local address. This is a cheap early-out so an
+// obviously bad URL never reaches the queue's rate limiter; it is not
+// sufficient on its own, because the name could resolve differently by
+// the time the request actually dials (DNS rebinding) or redirect
+// somewhere private after this check passes. guardedHTTPClient closes
+// both of those gaps.
+func rejectPrivateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	return checkHostAllowed(u.Hostname())
+}
+
+func checkHostAllowed(host string) error {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if isDisallowedIP(ip) {
+			return fmt.Errorf("refusing to fetch private address: %s", ip)
+		}
+	}
+	return nil
+}
+
+func isDisallowedIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// maxFetchRedirects bounds how many redirect hops a meta fetch will follow,
+// so a link can't chain redirects indefinitely or bounce through a public
+// then private address.
+const maxFetchRedirects = 3
+
+// fetchTimeout bounds dialing and the overall request, so one slow or
+// stalled host can't tie up the queue's single worker goroutine.
+const fetchTimeout = 5 * time.Second
+
+// guardedHTTPClient returns an http.Client whose Transport re-resolves and
+// re-validates the destination address at dial time, not just at the
+// rejectPrivateURL pre-check, and whose CheckRedirect applies the same
+// validation to every redirect hop and caps their number. fetchAndCache
+// passes this to metaFetcher.Fetch so the actual connection, not just the
+// URL string, is guarded against SSRF.
+func guardedHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: fetchTimeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+			if err != nil {
+				return nil, err
+			}
+
+			var lastErr error
+			for _, ip := range ips {
+				if isDisallowedIP(ip) {
+					lastErr = fmt.Errorf("refusing to dial private address: %s", ip)
+					continue
+				}
+				conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			if lastErr == nil {
+				lastErr = fmt.Errorf("no addresses found for %s", host)
+			}
+			return nil, lastErr
+		},
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxFetchRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return checkHostAllowed(req.URL.Hostname())
+		},
+	}
+}
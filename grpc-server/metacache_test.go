@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsDisallowedIP(t *testing.T) {
+	cases := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"private", "10.0.0.1", true},
+		{"private class B", "172.16.5.4", true},
+		{"private class C", "192.168.1.1", true},
+		{"loopback", "127.0.0.1", true},
+		{"loopback v6", "::1", true},
+		{"link-local unicast", "169.254.1.1", true},
+		{"link-local multicast", "224.0.0.1", true},
+		{"unspecified", "0.0.0.0", true},
+		{"public", "8.8.8.8", false},
+		{"public v6", "2001:4860:4860::8888", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ip := net.ParseIP(c.ip)
+			if ip == nil {
+				t.Fatalf("invalid test IP: %s", c.ip)
+			}
+			if got := isDisallowedIP(ip); got != c.want {
+				t.Errorf("isDisallowedIP(%s) = %v, want %v", c.ip, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRejectPrivateURL(t *testing.T) {
+	cases := []struct {
+		name    string
+		rawURL  string
+		wantErr bool
+	}{
+		{"loopback IP literal", "http://127.0.0.1/og", true},
+		{"private IP literal", "https://10.0.0.5/og", true},
+		{"link-local IP literal", "http://169.254.169.254/latest/meta-data", true},
+		{"unsupported scheme", "file:///etc/passwd", true},
+		{"ftp scheme", "ftp://example.com/og", true},
+		{"public IP literal", "http://93.184.216.34/og", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := rejectPrivateURL(c.rawURL)
+			if c.wantErr && err == nil {
+				t.Errorf("rejectPrivateURL(%q) = nil, want error", c.rawURL)
+			}
+			if !c.wantErr && err != nil {
+				t.Errorf("rejectPrivateURL(%q) = %v, want nil", c.rawURL, err)
+			}
+		})
+	}
+}
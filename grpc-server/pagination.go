@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize int32 = 20
+	maxPageSize     int32 = 100
+)
+
+// pageSizeOrDefault clamps a requested page size to (0, maxPageSize],
+// falling back to defaultPageSize when the caller didn't set one.
+func pageSizeOrDefault(pageSize int32) int32 {
+	switch {
+	case pageSize <= 0:
+		return defaultPageSize
+	case pageSize > maxPageSize:
+		return maxPageSize
+	default:
+		return pageSize
+	}
+}
+
+// encodePageToken and decodePageToken implement the opaque page_token used
+// by ListCalendars' keyset pagination: the last seen calendar id.
+func encodePageToken(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodePageToken(token string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page_token: %w", err)
+	}
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+// encodeSearchPageToken and decodeSearchPageToken implement the page_token
+// used by ListCalendars when a search query is set: results are ordered by
+// the search index's own ranking rather than by id, so continuation is by
+// offset (how many higher-ranked matches to skip) instead of a keyset.
+func encodeSearchPageToken(offset int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(int64(offset), 10)))
+}
+
+func decodeSearchPageToken(token string) (int32, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page_token: %w", err)
+	}
+	offset, err := strconv.ParseInt(string(b), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page_token: %w", err)
+	}
+	return int32(offset), nil
+}
+
+// encodeEntryPageToken and decodeEntryPageToken implement the page_token
+// used by ListEntries, which orders by (day, id) rather than id alone.
+func encodeEntryPageToken(day int32, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", day, id)))
+}
+
+func decodeEntryPageToken(token string) (int32, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page_token: %w", err)
+	}
+
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid page_token: %s", token)
+	}
+
+	day, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int32(day), id, nil
+}
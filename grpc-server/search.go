@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/mapping"
+
+	pb "github.com/adventar/adventar/grpc-server/adventar/v1"
+)
+
+// SearchIndex decouples ListCalendars' free-text search from the underlying
+// engine, so the SQL LIKE scan can be swapped for a real index without
+// touching the RPC handlers. offset is how many higher-ranked matches to
+// skip, so ListCalendars can page through search results instead of
+// re-fetching the same top pageSize matches on every page.
+type SearchIndex interface {
+	Index(calendar *pb.Calendar) error
+	Delete(id int64) error
+	Search(ctx context.Context, query string, year int32, pageSize int32, offset int32) ([]int64, error)
+}
+
+// sqlSearchIndex is the fallback indexer: it keeps no index of its own and
+// just re-runs the old `like` scan against the calendars table.
+type sqlSearchIndex struct {
+	db *sql.DB
+}
+
+func newSQLSearchIndex(db *sql.DB) *sqlSearchIndex {
+	return &sqlSearchIndex{db: db}
+}
+
+func (idx *sqlSearchIndex) Index(calendar *pb.Calendar) error { return nil }
+
+func (idx *sqlSearchIndex) Delete(id int64) error { return nil }
+
+func (idx *sqlSearchIndex) Search(ctx context.Context, query string, year int32, pageSize int32, offset int32) ([]int64, error) {
+	limitQuery := ""
+	args := []interface{}{year, "%" + query + "%", "%" + query + "%"}
+	if pageSize != 0 {
+		limitQuery = "limit ? offset ?"
+		args = append(args, pageSize, offset)
+	}
+
+	rows, err := idx.db.Query(`
+		select id from calendars
+		where year = ? and (title like ? or description like ?)
+		order by id desc
+		`+limitQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// calendarDoc is what bleveSearchIndex keeps in the index for each calendar.
+type calendarDoc struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	OwnerName   string `json:"owner_name"`
+	Year        int32  `json:"year"`
+}
+
+// bleveSearchIndex tokenizes title/description/owner name with a CJK
+// analyzer so kana/kanji queries work, which the `like` scan can't do.
+type bleveSearchIndex struct {
+	index bleve.Index
+}
+
+// newBleveSearchIndex opens (or creates) a bleve index at path.
+func newBleveSearchIndex(path string) (*bleveSearchIndex, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		index, err = bleve.New(path, buildCalendarIndexMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bleveSearchIndex{index: index}, nil
+}
+
+func buildCalendarIndexMapping() *mapping.IndexMappingImpl {
+	cjkFieldMapping := bleve.NewTextFieldMapping()
+	cjkFieldMapping.Analyzer = cjk.AnalyzerName
+
+	docMapping := bleve.NewDocumentMapping()
+	docMapping.AddFieldMappingsAt("title", cjkFieldMapping)
+	docMapping.AddFieldMappingsAt("description", cjkFieldMapping)
+	docMapping.AddFieldMappingsAt("owner_name", cjkFieldMapping)
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = docMapping
+	return indexMapping
+}
+
+func (idx *bleveSearchIndex) Index(calendar *pb.Calendar) error {
+	doc := calendarDoc{Title: calendar.GetTitle(), Description: calendar.GetDescription(), Year: calendar.GetYear()}
+	if calendar.GetOwner() != nil {
+		doc.OwnerName = calendar.GetOwner().GetName()
+	}
+	return idx.index.Index(strconv.FormatInt(calendar.GetId(), 10), doc)
+}
+
+func (idx *bleveSearchIndex) Delete(id int64) error {
+	return idx.index.Delete(strconv.FormatInt(id, 10))
+}
+
+func (idx *bleveSearchIndex) Search(ctx context.Context, query string, year int32, pageSize int32, offset int32) ([]int64, error) {
+	yearQuery := bleve.NewNumericRangeQuery(float64Ptr(float64(year)), float64Ptr(float64(year)+1))
+	yearQuery.SetField("year")
+
+	textQuery := bleve.NewMatchQuery(query)
+
+	req := bleve.NewSearchRequest(bleve.NewConjunctionQuery(yearQuery, textQuery))
+	if pageSize != 0 {
+		req.Size = int(pageSize)
+	}
+	req.From = int(offset)
+
+	result, err := idx.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		id, err := strconv.ParseInt(hit.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func float64Ptr(f float64) *float64 { return &f }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
@@ -20,8 +21,15 @@ type verifier interface {
 	VerifyIDToken(string) *AuthResult
 }
 
+// metaFetcher fetches OGP/Twitter Card metadata for a URL. It must perform
+// the request through client rather than dialing rawURL itself: client is
+// built by metacache.go to re-validate the resolved address at connect
+// time and on every redirect hop, which a plain rawURL string can't carry.
+// Implementations must also cap how much of the response body they read
+// (e.g. wrap it with http.MaxBytesReader), since a remote host is free to
+// send an arbitrarily large or never-ending response.
 type metaFetcher interface {
-	Fetch(string) (*SiteMeta, error)
+	Fetch(client *http.Client, rawURL string) (*SiteMeta, error)
 }
 
 // Service holds data used by grpc functions.
@@ -29,11 +37,21 @@ type Service struct {
 	db          *sql.DB
 	verifier    verifier
 	metaFetcher metaFetcher
+	searchIndex SearchIndex
+	metaCache   MetaCache
+	metaQueue   *metaFetchQueue
 }
 
 // NewService creates a new Service.
-func NewService(db *sql.DB, verifier verifier, metaFetcher metaFetcher) *Service {
-	return &Service{db: db, verifier: verifier, metaFetcher: metaFetcher}
+func NewService(db *sql.DB, verifier verifier, metaFetcher metaFetcher, searchIndex SearchIndex, metaCache MetaCache) *Service {
+	return &Service{
+		db:          db,
+		verifier:    verifier,
+		metaFetcher: metaFetcher,
+		searchIndex: searchIndex,
+		metaCache:   metaCache,
+		metaQueue:   newMetaFetchQueue(metaFetcher, metaCache),
+	}
 }
 
 func (s *Service) serve(addr string) {
@@ -51,21 +69,123 @@ func (s *Service) serve(addr string) {
 
 // ListCalendars lists calendars.
 func (s *Service) ListCalendars(ctx context.Context, in *pb.ListCalendarsRequest) (*pb.ListCalendarsResponse, error) {
+	pageSize := pageSizeOrDefault(in.GetPageSize())
+	searching := in.GetQuery() != ""
+
 	conditionQueries := []string{"c.year = ?"}
-	limitQuery := ""
 	conditionValues := []interface{}{in.GetYear()}
+
+	if !searching && in.GetPageToken() != "" {
+		cursor, err := decodePageToken(in.GetPageToken())
+		if err != nil {
+			return nil, err
+		}
+		conditionQueries = append(conditionQueries, "c.id < ?")
+		conditionValues = append(conditionValues, cursor)
+	}
 	if in.GetUserId() != 0 {
 		conditionQueries = append(conditionQueries, "c.user_id = ?")
 		conditionValues = append(conditionValues, in.GetUserId())
 	}
-	if in.GetQuery() != "" {
-		conditionQueries = append(conditionQueries, "(c.title like ? or c.description like ?)")
-		conditionValues = append(conditionValues, "%"+in.GetQuery()+"%", "%"+in.GetQuery()+"%")
+	if in.GetGroupName() != "" {
+		conditionQueries = append(conditionQueries, "c.group_id in (select id from groups where name = ?)")
+		conditionValues = append(conditionValues, in.GetGroupName())
 	}
-	if in.GetPageSize() != 0 {
-		limitQuery = "limit ?"
-		conditionValues = append(conditionValues, in.GetPageSize())
+
+	visibilityQuery, visibilityValues := s.visibilityCondition(ctx)
+	conditionQueries = append(conditionQueries, visibilityQuery)
+	conditionValues = append(conditionValues, visibilityValues...)
+
+	var calendars []*pb.Calendar
+	nextPageToken := ""
+
+	if searching {
+		// Search results are ordered by the index's own ranking, not by
+		// id, so they can't share the id-keyset page_token above: a search
+		// page_token carries an offset into that ranking instead.
+		var searchOffset int32
+		if in.GetPageToken() != "" {
+			offset, err := decodeSearchPageToken(in.GetPageToken())
+			if err != nil {
+				return nil, err
+			}
+			searchOffset = offset
+		}
+
+		// A batch of ids from the index can still shrink once the
+		// year/user/group/visibility filters apply, so one Search call
+		// isn't enough to fill a page. Keep pulling further batches -
+		// each no larger than the room left on the page, so every id
+		// taken from the index can land on it, and advancing searchOffset
+		// by what was actually consumed from the index, not by how many
+		// rows survived the filters - until the page is full or the index
+		// itself runs out.
+		exhausted := false
+		for int32(len(calendars)) < pageSize && !exhausted {
+			room := pageSize - int32(len(calendars))
+			ids, err := s.searchIndex.Search(ctx, in.GetQuery(), in.GetYear(), room, searchOffset)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			searchOffset += int32(len(ids))
+			if int32(len(ids)) < room {
+				exhausted = true
+			}
+
+			matched, err := s.findCalendarsByIDs(ids, conditionQueries, conditionValues, room)
+			if err != nil {
+				return nil, err
+			}
+			calendars = append(calendars, matched...)
+		}
+
+		if int32(len(calendars)) == pageSize && !exhausted {
+			nextPageToken = encodeSearchPageToken(searchOffset)
+		}
+	} else {
+		matched, err := s.findCalendarsByIDs(nil, conditionQueries, conditionValues, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		calendars = matched
+
+		if int32(len(calendars)) == pageSize {
+			nextPageToken = encodePageToken(calendars[len(calendars)-1].Id)
+		}
 	}
+
+	if len(calendars) != 0 {
+		err := s.bindEntryCount(calendars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.ListCalendarsResponse{Calendars: calendars, NextPageToken: nextPageToken}, nil
+}
+
+// findCalendarsByIDs runs the calendars query shared by ListCalendars'
+// search and non-search paths: conditionQueries/conditionValues hold the
+// year/user/group/visibility filters common to both, ids (when non-nil)
+// further restricts to a batch of search hits, and limit caps how many
+// rows to return.
+func (s *Service) findCalendarsByIDs(ids []int64, conditionQueries []string, conditionValues []interface{}, limit int32) ([]*pb.Calendar, error) {
+	queries := conditionQueries
+	values := append([]interface{}{}, conditionValues...)
+
+	if ids != nil {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			values = append(values, id)
+		}
+		queries = append(append([]string{}, queries...), fmt.Sprintf("c.id in (%s)", strings.Join(placeholders, ",")))
+	}
+
+	values = append(values, limit)
 	sql := fmt.Sprintf(`
 		select
 			c.id,
@@ -79,14 +199,15 @@ func (s *Service) ListCalendars(ctx context.Context, in *pb.ListCalendarsRequest
 		inner join users as u on u.id = c.user_id
 		where %s
 		order by c.id desc
-		%s
-	`, strings.Join(conditionQueries, " and "), limitQuery)
+		limit ?
+	`, strings.Join(queries, " and "))
 
-	rows, err := s.db.Query(sql, conditionValues...)
+	rows, err := s.db.Query(sql, values...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
 	var calendars []*pb.Calendar
 	for rows.Next() {
 		var calendar pb.Calendar
@@ -107,18 +228,18 @@ func (s *Service) ListCalendars(ctx context.Context, in *pb.ListCalendarsRequest
 		calendars = append(calendars, &calendar)
 	}
 
-	if len(calendars) != 0 {
-		err := s.bindEntryCount(calendars)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return &pb.ListCalendarsResponse{Calendars: calendars}, nil
+	return calendars, nil
 }
 
 // GetCalendar returns a calendar.
 func (s *Service) GetCalendar(ctx context.Context, in *pb.GetCalendarRequest) (*pb.GetCalendarResponse, error) {
+	currentUser := s.tryCurrentUser(ctx)
+	if canRead, err := s.calendarVisibleTo(in.GetCalendarId(), currentUser); err != nil {
+		return nil, err
+	} else if !canRead {
+		return nil, fmt.Errorf("calendar %d not found", in.GetCalendarId())
+	}
+
 	var calendar calendar
 	row := s.db.QueryRow("select id, user_id, title, description, year from calendars where id = ?", in.GetCalendarId())
 	err := row.Scan(&calendar.ID, &calendar.UserID, &calendar.Title, &calendar.Description, &calendar.Year)
@@ -148,13 +269,18 @@ func (s *Service) CreateCalendar(ctx context.Context, in *pb.CreateCalendarReque
 		return nil, err
 	}
 
-	stmt, err := s.db.Prepare("insert into calendars(user_id, title, description, year) values(?, ?, ?, ?)")
+	visibility, groupID, err := s.resolveVisibility(in.GetVisibility(), in.GetGroupId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.db.Prepare("insert into calendars(user_id, title, description, year, visibility, group_id) values(?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(currentUser.ID, in.GetTitle(), in.GetDescription(), time.Now().Year())
+	res, err := stmt.Exec(currentUser.ID, in.GetTitle(), in.GetDescription(), time.Now().Year(), visibility, groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -164,13 +290,23 @@ func (s *Service) CreateCalendar(ctx context.Context, in *pb.CreateCalendarReque
 		return nil, err
 	}
 
+	if _, err := s.db.Exec("insert into calendar_members(calendar_id, user_id, can_write, is_owner) values(?, ?, ?, ?)", lastID, currentUser.ID, true, true); err != nil {
+		return nil, err
+	}
+
 	var calendar calendar
 	err = s.db.QueryRow("select id, user_id, title, description, year from calendars where id = ?", lastID).Scan(&calendar.ID, &calendar.UserID, &calendar.Title, &calendar.Description, &calendar.Year)
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.Calendar{Id: calendar.ID, Title: calendar.Title, Description: calendar.Description, Year: calendar.Year}, nil
+	pbCalendar := &pb.Calendar{Id: calendar.ID, Title: calendar.Title, Description: calendar.Description, Year: calendar.Year}
+	indexed := &pb.Calendar{Id: calendar.ID, Title: calendar.Title, Description: calendar.Description, Year: calendar.Year, Owner: &pb.User{Id: currentUser.ID, Name: currentUser.Name}}
+	if err := s.searchIndex.Index(indexed); err != nil {
+		return nil, err
+	}
+
+	return pbCalendar, nil
 }
 
 // UpdateCalendar updates the calendar.
@@ -179,13 +315,27 @@ func (s *Service) UpdateCalendar(ctx context.Context, in *pb.UpdateCalendarReque
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := s.db.Prepare("update calendars set title = ?, description = ? where id = ? and user_id = ?")
+
+	canWrite, err := s.canWriteCalendar(in.GetCalendarId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !canWrite {
+		return nil, fmt.Errorf("not a member of calendar %d", in.GetCalendarId())
+	}
+
+	visibility, groupID, err := s.resolveVisibility(in.GetVisibility(), in.GetGroupId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.db.Prepare("update calendars set title = ?, description = ?, visibility = ?, group_id = ? where id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(in.GetTitle(), in.GetDescription(), in.GetCalendarId(), currentUser.ID)
+	_, err = stmt.Exec(in.GetTitle(), in.GetDescription(), visibility, groupID, in.GetCalendarId())
 	if err != nil {
 		return nil, err
 	}
@@ -196,27 +346,56 @@ func (s *Service) UpdateCalendar(ctx context.Context, in *pb.UpdateCalendarReque
 		return nil, err
 	}
 
+	var ownerName string
+	if err := s.db.QueryRow("select name from users where id = ?", calendar.UserID).Scan(&ownerName); err != nil {
+		return nil, err
+	}
+	indexed := &pb.Calendar{Id: calendar.ID, Title: calendar.Title, Description: calendar.Description, Year: calendar.Year, Owner: &pb.User{Id: calendar.UserID, Name: ownerName}}
+	if err := s.searchIndex.Index(indexed); err != nil {
+		return nil, err
+	}
+
 	return &pb.Calendar{Id: calendar.ID, Title: calendar.Title, Description: calendar.Description, Year: calendar.Year}, nil
 }
 
-// DeleteCalendar deletes the calendar.
+// DeleteCalendar deletes the calendar. Only the owner may do this, even if
+// other members have write access.
 func (s *Service) DeleteCalendar(ctx context.Context, in *pb.DeleteCalendarRequest) (*empty.Empty, error) {
 	currentUser, err := s.getCurrentUser(ctx)
-	stmt, err := s.db.Prepare("delete from calendars where id = ? and user_id = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	isOwner, err := s.isCalendarOwner(in.GetCalendarId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwner {
+		return nil, fmt.Errorf("not the owner of calendar %d", in.GetCalendarId())
+	}
+
+	stmt, err := s.db.Prepare("delete from calendars where id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(in.GetCalendarId(), currentUser.ID)
+	_, err = stmt.Exec(in.GetCalendarId())
 	if err != nil {
 		return nil, err
 	}
+
+	if err := s.searchIndex.Delete(in.GetCalendarId()); err != nil {
+		return nil, err
+	}
+
 	return &empty.Empty{}, nil
 }
 
 // ListEntries lists entries.
 func (s *Service) ListEntries(ctx context.Context, in *pb.ListEntriesRequest) (*pb.ListEntriesResponse, error) {
+	pageSize := pageSizeOrDefault(in.GetPageSize())
+
 	conditionQueries := []string{"e.user_id = ?"}
 	conditionValues := []interface{}{in.GetUserId()}
 
@@ -225,6 +404,16 @@ func (s *Service) ListEntries(ctx context.Context, in *pb.ListEntriesRequest) (*
 		conditionValues = append(conditionValues, in.GetYear())
 	}
 
+	if in.GetPageToken() != "" {
+		day, id, err := decodeEntryPageToken(in.GetPageToken())
+		if err != nil {
+			return nil, err
+		}
+		conditionQueries = append(conditionQueries, "(e.day > ? or (e.day = ? and e.id > ?))")
+		conditionValues = append(conditionValues, day, day, id)
+	}
+
+	conditionValues = append(conditionValues, pageSize)
 	sql := fmt.Sprintf(`
 		select
 			e.id,
@@ -243,14 +432,15 @@ func (s *Service) ListEntries(ctx context.Context, in *pb.ListEntriesRequest) (*
 		inner join users as u on u.id = e.user_id
 		inner join calendars as c on c.id = e.calendar_id
 		where %s
-		order by e.day
+		order by e.day, e.id
+		limit ?
 	`, strings.Join(conditionQueries, " and "))
 
 	rows, err := s.db.Query(sql, conditionValues...)
-	defer rows.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	entries := []*pb.Entry{}
 	for rows.Next() {
@@ -279,7 +469,13 @@ func (s *Service) ListEntries(ctx context.Context, in *pb.ListEntriesRequest) (*
 		entries = append(entries, &e)
 	}
 
-	return &pb.ListEntriesResponse{Entries: entries}, nil
+	nextPageToken := ""
+	if int32(len(entries)) == pageSize {
+		last := entries[len(entries)-1]
+		nextPageToken = encodeEntryPageToken(last.Day, last.Id)
+	}
+
+	return &pb.ListEntriesResponse{Entries: entries, NextPageToken: nextPageToken}, nil
 }
 
 // CreateEntry creates a entry.
@@ -289,6 +485,14 @@ func (s *Service) CreateEntry(ctx context.Context, in *pb.CreateEntryRequest) (*
 		return nil, err
 	}
 
+	canWrite, err := s.canWriteCalendar(in.GetCalendarId(), currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !canWrite {
+		return nil, fmt.Errorf("not a member of calendar %d", in.GetCalendarId())
+	}
+
 	var year int
 	row := s.db.QueryRow("select year from calendars where id = ?", in.GetCalendarId())
 	err = row.Scan(&year)
@@ -327,39 +531,58 @@ func (s *Service) CreateEntry(ctx context.Context, in *pb.CreateEntryRequest) (*
 	return &pb.Entry{Id: entryID}, nil
 }
 
-// UpdateEntry updates the entry.
+// UpdateEntry updates the entry. Any calendar write-collaborator may edit
+// any entry on that calendar, not just its own author, matching
+// CreateEntry's access rule. DeleteEntry is narrower: only the entry's
+// author or the calendar owner may delete an entry.
 func (s *Service) UpdateEntry(ctx context.Context, in *pb.UpdateEntryRequest) (*pb.Entry, error) {
 	currentUser, err := s.getCurrentUser(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	stmt, err := s.db.Prepare("update entries set comment = ?, url = ? where id = ? and user_id = ?")
+	var calendarID int64
+	row := s.db.QueryRow("select calendar_id from entries where id = ?", in.GetEntryId())
+	if err := row.Scan(&calendarID); err != nil {
+		return nil, err
+	}
+
+	canWrite, err := s.canWriteCalendar(calendarID, currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !canWrite {
+		return nil, fmt.Errorf("not a member of calendar %d", calendarID)
+	}
+
+	stmt, err := s.db.Prepare("update entries set comment = ?, url = ? where id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(in.GetComment(), in.GetUrl(), in.GetEntryId(), currentUser.ID)
+	_, err = stmt.Exec(in.GetComment(), in.GetUrl(), in.GetEntryId())
 	if err != nil {
 		return nil, err
 	}
 
 	if in.GetUrl() != "" {
-		m, err := s.metaFetcher.Fetch(in.GetUrl())
-		// TODO: Ignore error
-		if err != nil {
-			return nil, err
-		}
-		stmt, err = s.db.Prepare("update entries set title = ?, image_url = ? where id = ? and user_id = ?")
-		if err != nil {
-			return nil, err
-		}
-		defer stmt.Close()
-
-		_, err = stmt.Exec(m.Title, m.ImageURL, in.GetEntryId(), currentUser.ID)
-		if err != nil {
+		if cached, err := s.metaCache.Get(in.GetUrl()); err != nil {
 			return nil, err
+		} else if cached != nil {
+			stmt, err = s.db.Prepare("update entries set title = ?, image_url = ? where id = ?")
+			if err != nil {
+				return nil, err
+			}
+			defer stmt.Close()
+
+			if _, err := stmt.Exec(cached.Title, cached.ImageURL, in.GetEntryId()); err != nil {
+				return nil, err
+			}
+		} else {
+			// Cache miss: don't block this RPC on a possibly slow or hostile
+			// site, fetch it off the request path instead.
+			s.metaQueue.Enqueue(in.GetUrl())
 		}
 	}
 
@@ -375,20 +598,41 @@ func (s *Service) UpdateEntry(ctx context.Context, in *pb.UpdateEntryRequest) (*
 	return &pb.Entry{Id: in.GetEntryId(), Comment: comment, Url: url, Title: title, ImageUrl: imageURL}, nil
 }
 
-// DeleteEntry deletes the entry.
+// DeleteEntry deletes the entry. The entry's own author can always remove
+// it; a calendar owner can also remove any entry on their calendar.
 func (s *Service) DeleteEntry(ctx context.Context, in *pb.DeleteEntryRequest) (*empty.Empty, error) {
 	currentUser, err := s.getCurrentUser(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Calendar owner can cancel entry
-	stmt, err := s.db.Prepare("delete from entries where id = ? and user_id = ?")
+	var calendarID int64
+	row := s.db.QueryRow("select calendar_id from entries where id = ?", in.GetEntryId())
+	if err := row.Scan(&calendarID); err != nil {
+		return nil, err
+	}
+
+	isOwner, err := s.isCalendarOwner(calendarID, currentUser.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = stmt.Exec(in.GetEntryId(), currentUser.ID)
+	var stmt *sql.Stmt
+	if isOwner {
+		stmt, err = s.db.Prepare("delete from entries where id = ?")
+	} else {
+		stmt, err = s.db.Prepare("delete from entries where id = ? and user_id = ?")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	if isOwner {
+		_, err = stmt.Exec(in.GetEntryId())
+	} else {
+		_, err = stmt.Exec(in.GetEntryId(), currentUser.ID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -466,7 +710,19 @@ func (s *Service) getCurrentUser(ctx context.Context) (*user, error) {
 		return nil, fmt.Errorf("not found authorization in metadata")
 	}
 
-	authResult := s.verifier.VerifyIDToken(values[0])
+	return s.userFromToken(values[0])
+}
+
+// userFromToken resolves the user a bare ID token belongs to, for callers
+// that don't carry it in gRPC metadata (e.g. the CalDAV frontend's HTTP
+// Basic auth). VerifyIDToken never returns nil; an invalid or expired token
+// comes back as an AuthResult with an empty AuthUID/AuthProvider, which
+// can't match any row, so that's what's checked for.
+func (s *Service) userFromToken(token string) (*user, error) {
+	authResult := s.verifier.VerifyIDToken(token)
+	if authResult.AuthUID == "" || authResult.AuthProvider == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
 
 	var user user
 	err := s.db.QueryRow("select id, name, icon_url from users where auth_provider = ? and auth_uid = ?", authResult.AuthProvider, authResult.AuthUID).Scan(&user.ID, &user.Name, &user.IconURL)
@@ -477,29 +733,145 @@ func (s *Service) getCurrentUser(ctx context.Context) (*user, error) {
 	return &user, nil
 }
 
-func (s *Service) bindEntryCount(calendars []*pb.Calendar) error {
-	ids := []interface{}{}
-	interpolations := []string{}
+// tryCurrentUser resolves the caller like getCurrentUser, but returns nil
+// instead of an error when no caller is authenticated. It's used by RPCs
+// such as ListCalendars that behave differently for anonymous callers
+// rather than rejecting them.
+func (s *Service) tryCurrentUser(ctx context.Context) *user {
+	u, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return nil
+	}
+	return u
+}
 
-	for _, c := range calendars {
-		ids = append(ids, c.Id)
-		interpolations = append(interpolations, "?")
+// visibilityCondition builds the where-clause fragment and bind values that
+// scope ListCalendars to what ctx's caller is allowed to see: everyone sees
+// public calendars, and authenticated callers additionally see calendars
+// they own, are a write/read member of via calendar_members, or that belong
+// to a group they are a member of.
+func (s *Service) visibilityCondition(ctx context.Context) (string, []interface{}) {
+	currentUser := s.tryCurrentUser(ctx)
+	if currentUser == nil {
+		return "c.visibility = 'public'", nil
+	}
+
+	return `(c.visibility = 'public'
+		or c.user_id = ?
+		or exists(select 1 from calendar_members where calendar_id = c.id and user_id = ?)
+		or (c.visibility = 'group' and c.group_id in (select group_id from group_members where user_id = ?)))`,
+		[]interface{}{currentUser.ID, currentUser.ID, currentUser.ID}
+}
+
+// calendarVisibleTo is the single-calendar equivalent of visibilityCondition,
+// used by endpoints (GetCalendar, the iCal feeds, CalDAV) that look up one
+// calendar by ID rather than scanning a list. currentUser is nil for
+// unauthenticated callers.
+func (s *Service) calendarVisibleTo(calendarID int64, currentUser *user) (bool, error) {
+	var visibility string
+	var ownerID int64
+	var groupID sql.NullInt64
+	row := s.db.QueryRow("select visibility, user_id, group_id from calendars where id = ?", calendarID)
+	if err := row.Scan(&visibility, &ownerID, &groupID); err != nil {
+		return false, err
+	}
+
+	if visibility == "public" {
+		return true, nil
+	}
+	if currentUser == nil {
+		return false, nil
+	}
+	if ownerID == currentUser.ID {
+		return true, nil
+	}
+	if visibility == "group" && groupID.Valid {
+		var isMember bool
+		row := s.db.QueryRow("select 1 from group_members where group_id = ? and user_id = ?", groupID.Int64, currentUser.ID)
+		err := row.Scan(&isMember)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		if isMember {
+			return true, nil
+		}
 	}
 
-	sql := fmt.Sprintf("select calendar_id, count(*) from entries where calendar_id in (%s) group by calendar_id", strings.Join(interpolations, ","))
-	rows, err := s.db.Query(sql, ids...)
-	if err != nil {
-		return err
+	var isCalendarMember bool
+	row = s.db.QueryRow("select 1 from calendar_members where calendar_id = ? and user_id = ?", calendarID, currentUser.ID)
+	err := row.Scan(&isCalendarMember)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return isCalendarMember, nil
+}
+
+// resolveVisibility validates the visibility/group_id pair a caller wants to
+// set on a calendar via CreateCalendar/UpdateCalendar, returning the values
+// to persist. "group" visibility requires groupID to name a group userID is
+// actually a member of, so calendars can't be scoped to a group the caller
+// has no standing in.
+func (s *Service) resolveVisibility(visibility string, groupID int64, userID int64) (string, sql.NullInt64, error) {
+	switch visibility {
+	case "", "public":
+		return "public", sql.NullInt64{}, nil
+	case "private":
+		return "private", sql.NullInt64{}, nil
+	case "group":
+		if groupID == 0 {
+			return "", sql.NullInt64{}, fmt.Errorf("group_id is required for group visibility")
+		}
+		var isMember bool
+		row := s.db.QueryRow("select 1 from group_members where group_id = ? and user_id = ?", groupID, userID)
+		err := row.Scan(&isMember)
+		if err == sql.ErrNoRows {
+			return "", sql.NullInt64{}, fmt.Errorf("not a member of group %d", groupID)
+		}
+		if err != nil {
+			return "", sql.NullInt64{}, err
+		}
+		return "group", sql.NullInt64{Int64: groupID, Valid: true}, nil
+	default:
+		return "", sql.NullInt64{}, fmt.Errorf("invalid visibility: %s", visibility)
 	}
+}
 
+// bindEntryCount fills in EntryCount for each calendar. calendars is chunked
+// to at most maxPageSize per query so a caller can never turn this into an
+// unbounded IN-list.
+func (s *Service) bindEntryCount(calendars []*pb.Calendar) error {
 	entryCounts := map[int64]int32{}
-	for rows.Next() {
-		var cid int64
-		var count int32
-		if err := rows.Scan(&cid, &count); err != nil {
+
+	for remaining := calendars; len(remaining) > 0; {
+		chunk := remaining
+		if int32(len(chunk)) > maxPageSize {
+			chunk = chunk[:maxPageSize]
+		}
+		remaining = remaining[len(chunk):]
+
+		ids := make([]interface{}, len(chunk))
+		interpolations := make([]string, len(chunk))
+		for i, c := range chunk {
+			ids[i] = c.Id
+			interpolations[i] = "?"
+		}
+
+		sql := fmt.Sprintf("select calendar_id, count(*) from entries where calendar_id in (%s) group by calendar_id", strings.Join(interpolations, ","))
+		rows, err := s.db.Query(sql, ids...)
+		if err != nil {
 			return err
 		}
-		entryCounts[cid] = count
+
+		for rows.Next() {
+			var cid int64
+			var count int32
+			if err := rows.Scan(&cid, &count); err != nil {
+				rows.Close()
+				return err
+			}
+			entryCounts[cid] = count
+		}
+		rows.Close()
 	}
 
 	for _, c := range calendars {
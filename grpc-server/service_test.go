@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCalendarVisibleTo(t *testing.T) {
+	const calendarID = int64(10)
+	owner := &user{ID: 1}
+	member := &user{ID: 2}
+	stranger := &user{ID: 3}
+
+	cases := []struct {
+		name             string
+		visibility       string
+		groupID          interface{} // nil or int64
+		currentUser      *user
+		isGroupMember    bool
+		isCalendarMember bool
+		want             bool
+	}{
+		{name: "public, anonymous", visibility: "public", currentUser: nil, want: true},
+		{name: "private, anonymous", visibility: "private", currentUser: nil, want: false},
+		{name: "private, owner", visibility: "private", currentUser: owner, want: true},
+		{name: "private, stranger", visibility: "private", currentUser: stranger, want: false},
+		{name: "private, collaborator via calendar_members", visibility: "private", currentUser: member, isCalendarMember: true, want: true},
+		{name: "group, group member", visibility: "group", groupID: int64(7), currentUser: member, isGroupMember: true, want: true},
+		{name: "group, collaborator but not group member", visibility: "group", groupID: int64(7), currentUser: member, isCalendarMember: true, want: true},
+		{name: "group, neither", visibility: "group", groupID: int64(7), currentUser: stranger, want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+
+			row := sqlmock.NewRows([]string{"visibility", "user_id", "group_id"}).
+				AddRow(c.visibility, owner.ID, c.groupID)
+			mock.ExpectQuery("select visibility, user_id, group_id from calendars").
+				WithArgs(calendarID).
+				WillReturnRows(row)
+
+			if c.visibility != "public" && c.currentUser != nil {
+				if c.visibility == "group" && c.groupID != nil {
+					groupRows := sqlmock.NewRows([]string{"1"})
+					if c.isGroupMember {
+						groupRows.AddRow(1)
+					}
+					mock.ExpectQuery("select 1 from group_members").
+						WithArgs(c.groupID, c.currentUser.ID).
+						WillReturnRows(groupRows)
+				}
+				if c.currentUser.ID != owner.ID && !c.isGroupMember {
+					memberRows := sqlmock.NewRows([]string{"1"})
+					if c.isCalendarMember {
+						memberRows.AddRow(1)
+					}
+					mock.ExpectQuery("select 1 from calendar_members").
+						WithArgs(calendarID, c.currentUser.ID).
+						WillReturnRows(memberRows)
+				}
+			}
+
+			s := &Service{db: db}
+			got, err := s.calendarVisibleTo(calendarID, c.currentUser)
+			if err != nil {
+				t.Fatalf("calendarVisibleTo() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("calendarVisibleTo() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}